@@ -0,0 +1,55 @@
+package hooks
+
+import (
+  "bytes"
+  "context"
+  "encoding/json"
+  "fmt"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "time"
+)
+
+// FileHandler runs an executable named after the event, in Dir, passing the
+// JSON payload on stdin. A missing script is not an error: that event is
+// simply not hooked. A script that doesn't exit within Timeout is killed via
+// its context, rather than left to finish on its own, since an admin's hook
+// script (e.g. a stuck AV scan) is outside this process's control and would
+// otherwise leak a goroutine and a child process for as long as it runs.
+type FileHandler struct {
+  Dir     string
+  Timeout time.Duration
+}
+
+func NewFileHandler(dir string, timeout time.Duration) *FileHandler {
+  return &FileHandler{Dir: dir, Timeout: timeout}
+}
+
+func (h *FileHandler) Invoke(event Event, payload Payload) error {
+  script := filepath.Join(h.Dir, string(event))
+  if _, err := os.Stat(script); os.IsNotExist(err) {
+    return nil
+  }
+
+  body, err := json.Marshal(payload)
+  if err != nil {
+    return err
+  }
+
+  ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+  defer cancel()
+
+  cmd := exec.CommandContext(ctx, script)
+  cmd.Stdin = bytes.NewReader(body)
+  var stderr bytes.Buffer
+  cmd.Stderr = &stderr
+
+  if err := cmd.Run(); err != nil {
+    if ctx.Err() == context.DeadlineExceeded {
+      return fmt.Errorf("hooks: %s hook timed out after %s", event, h.Timeout)
+    }
+    return fmt.Errorf("hooks: %s hook failed: %s: %s", event, err, stderr.String())
+  }
+  return nil
+}
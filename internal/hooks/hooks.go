@@ -0,0 +1,42 @@
+// Package hooks lets operators react to upload lifecycle events —
+// pre-create, post-receive, post-finish and post-terminate — without
+// modifying tusc-s5 itself, by running a script per event or POSTing a JSON
+// payload to an HTTP endpoint.
+package hooks
+
+// Event identifies which point in an upload's lifecycle a hook fires at.
+type Event string
+
+const (
+  // PreCreate fires before an upload is created. A Handler may abort the
+  // upload by returning an error for this event.
+  PreCreate Event = "pre-create"
+  // PostReceive fires as data is written to an upload.
+  PostReceive Event = "post-receive"
+  // PostFinish fires once an upload has completed successfully.
+  PostFinish Event = "post-finish"
+  // PostTerminate fires once an upload has been terminated.
+  PostTerminate Event = "post-terminate"
+)
+
+// Upload is the subset of a tusd.FileInfo that hook payloads carry.
+type Upload struct {
+  ID         string            `json:"ID"`
+  Size       int64             `json:"Size"`
+  Offset     int64             `json:"Offset"`
+  MetaData   map[string]string `json:"MetaData"`
+  RemoteAddr string            `json:"RemoteAddr"`
+}
+
+// Payload is the JSON body sent to every hook, on stdin for file hooks and
+// as the request body for HTTP hooks.
+type Payload struct {
+  Upload Upload `json:"Upload"`
+}
+
+// Handler invokes hooks for upload lifecycle events. Invoke returns an error
+// whenever the hook fails, for any event; only an error for PreCreate aborts
+// the upload.
+type Handler interface {
+  Invoke(event Event, payload Payload) error
+}
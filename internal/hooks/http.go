@@ -0,0 +1,68 @@
+package hooks
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "time"
+)
+
+// HTTPHandler POSTs the JSON payload to URL for every event, retrying up to
+// Retry times with Backoff between attempts if the request fails or the
+// endpoint returns a non-2xx status. Each attempt is bounded by Timeout, so
+// that a Retry count meant to ride out transient failures can't turn one
+// unresponsive endpoint into Retry+1 separate indefinite hangs.
+type HTTPHandler struct {
+  URL     string
+  Retry   int
+  Backoff time.Duration
+  Timeout time.Duration
+
+  client *http.Client
+}
+
+func NewHTTPHandler(url string, retry int, backoff, timeout time.Duration) *HTTPHandler {
+  return &HTTPHandler{
+    URL:     url,
+    Retry:   retry,
+    Backoff: backoff,
+    Timeout: timeout,
+    client:  &http.Client{Timeout: timeout},
+  }
+}
+
+func (h *HTTPHandler) Invoke(event Event, payload Payload) error {
+  body, err := json.Marshal(payload)
+  if err != nil {
+    return err
+  }
+
+  var lastErr error
+  for attempt := 0; attempt <= h.Retry; attempt++ {
+    if attempt > 0 {
+      time.Sleep(h.Backoff)
+    }
+
+    req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+    if err != nil {
+      return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Tusc-Hook-Event", string(event))
+
+    resp, err := h.client.Do(req)
+    if err != nil {
+      lastErr = err
+      continue
+    }
+    resp.Body.Close()
+
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+      return nil
+    }
+    lastErr = fmt.Errorf("hooks: %s hook received status %s from %s", event, resp.Status, h.URL)
+  }
+
+  return lastErr
+}
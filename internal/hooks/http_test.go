@@ -0,0 +1,75 @@
+package hooks
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "sync/atomic"
+  "testing"
+  "time"
+)
+
+func TestHTTPHandlerInvokeSucceedsAfterRetries(t *testing.T) {
+  var attempts int32
+  srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if atomic.AddInt32(&attempts, 1) < 3 {
+      w.WriteHeader(http.StatusInternalServerError)
+      return
+    }
+    w.WriteHeader(http.StatusOK)
+  }))
+  defer srv.Close()
+
+  h := NewHTTPHandler(srv.URL, 2, time.Millisecond, time.Second)
+  if err := h.Invoke(PostFinish, Payload{}); err != nil {
+    t.Fatalf("Invoke: unexpected error: %s", err)
+  }
+  if got := atomic.LoadInt32(&attempts); got != 3 {
+    t.Fatalf("Invoke: got %d attempts, want 3", got)
+  }
+}
+
+// TestHTTPHandlerInvokeGivesUpAfterRetry confirms Invoke stops after
+// Retry retries (Retry+1 attempts total) and surfaces the last failure.
+func TestHTTPHandlerInvokeGivesUpAfterRetry(t *testing.T) {
+  var attempts int32
+  srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    atomic.AddInt32(&attempts, 1)
+    w.WriteHeader(http.StatusInternalServerError)
+  }))
+  defer srv.Close()
+
+  h := NewHTTPHandler(srv.URL, 2, time.Millisecond, time.Second)
+  err := h.Invoke(PostFinish, Payload{})
+  if err == nil {
+    t.Fatal("Invoke: expected error, got nil")
+  }
+  if !strings.Contains(err.Error(), "500") && !strings.Contains(err.Error(), "Internal Server Error") {
+    t.Fatalf("Invoke: error %q does not reflect the last response", err)
+  }
+  if got := atomic.LoadInt32(&attempts); got != 3 {
+    t.Fatalf("Invoke: got %d attempts, want 3 (1 + Retry)", got)
+  }
+}
+
+// TestHTTPHandlerInvokeWaitsBackoff confirms each retry is spaced by at
+// least Backoff.
+func TestHTTPHandlerInvokeWaitsBackoff(t *testing.T) {
+  var attempts int32
+  srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    atomic.AddInt32(&attempts, 1)
+    w.WriteHeader(http.StatusInternalServerError)
+  }))
+  defer srv.Close()
+
+  backoff := 50 * time.Millisecond
+  h := NewHTTPHandler(srv.URL, 1, backoff, time.Second)
+
+  start := time.Now()
+  if err := h.Invoke(PostFinish, Payload{}); err == nil {
+    t.Fatal("Invoke: expected error, got nil")
+  }
+  if elapsed := time.Since(start); elapsed < backoff {
+    t.Fatalf("Invoke: retried after %s, want at least Backoff (%s)", elapsed, backoff)
+  }
+}
@@ -0,0 +1,61 @@
+// Package memorylocker implements a tusd.Locker that keeps upload locks in
+// an in-process map, guarding the filestore/s5store backends against
+// corruption from two concurrent requests for the same upload.
+package memorylocker
+
+import (
+  "github.com/tus/tusd"
+  "sync"
+)
+
+// MemoryLocker is a tusd.Locker backed by a mutex-guarded set of upload IDs.
+// It only protects uploads against concurrent requests handled by the same
+// process; running multiple instances behind a load balancer requires
+// internal/redislocker instead.
+type MemoryLocker struct {
+  mutex sync.Mutex
+  locks map[string]struct{}
+}
+
+// New returns a ready to use MemoryLocker.
+func New() *MemoryLocker {
+  return &MemoryLocker{
+    locks: make(map[string]struct{}),
+  }
+}
+
+// UseIn registers this locker as composer's Locker.
+func (l *MemoryLocker) UseIn(composer *tusd.StoreComposer) {
+  composer.UseLocker(l)
+}
+
+// LockUpload acquires the lock for id, failing with tusd.ErrFileLocked if
+// another request already holds it.
+func (l *MemoryLocker) LockUpload(id string) error {
+  l.mutex.Lock()
+  defer l.mutex.Unlock()
+
+  if _, locked := l.locks[id]; locked {
+    return tusd.ErrFileLocked
+  }
+  l.locks[id] = struct{}{}
+  return nil
+}
+
+// UnlockUpload releases the lock for id.
+func (l *MemoryLocker) UnlockUpload(id string) error {
+  l.mutex.Lock()
+  defer l.mutex.Unlock()
+
+  delete(l.locks, id)
+  return nil
+}
+
+// Shutdown releases every lock this locker currently holds. It has nothing
+// else to do: an in-process map has no outside state to clean up.
+func (l *MemoryLocker) Shutdown() {
+  l.mutex.Lock()
+  defer l.mutex.Unlock()
+
+  l.locks = make(map[string]struct{})
+}
@@ -0,0 +1,73 @@
+package memorylocker
+
+import (
+  "sync"
+  "testing"
+)
+
+func TestLockUnlock(t *testing.T) {
+  l := New()
+
+  if err := l.LockUpload("upload-1"); err != nil {
+    t.Fatalf("LockUpload: unexpected error: %s", err)
+  }
+  if err := l.UnlockUpload("upload-1"); err != nil {
+    t.Fatalf("UnlockUpload: unexpected error: %s", err)
+  }
+  if err := l.LockUpload("upload-1"); err != nil {
+    t.Fatalf("LockUpload after unlock: unexpected error: %s", err)
+  }
+}
+
+func TestLockUploadAlreadyLocked(t *testing.T) {
+  l := New()
+
+  if err := l.LockUpload("upload-1"); err != nil {
+    t.Fatalf("LockUpload: unexpected error: %s", err)
+  }
+  if err := l.LockUpload("upload-1"); err == nil {
+    t.Fatal("LockUpload: expected error locking an already-locked upload, got nil")
+  }
+}
+
+// TestConcurrentLockUpload races many goroutines against LockUpload for the
+// same upload ID: exactly one must win. Run with -race to catch any data
+// race in the mutex-guarded map.
+func TestConcurrentLockUpload(t *testing.T) {
+  l := New()
+
+  const attempts = 50
+  var wins int32
+  var mu sync.Mutex
+  var wg sync.WaitGroup
+
+  for i := 0; i < attempts; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      if err := l.LockUpload("upload-1"); err == nil {
+        mu.Lock()
+        wins++
+        mu.Unlock()
+      }
+    }()
+  }
+  wg.Wait()
+
+  if wins != 1 {
+    t.Fatalf("expected exactly 1 goroutine to acquire the lock, got %d", wins)
+  }
+}
+
+func TestShutdownReleasesLocks(t *testing.T) {
+  l := New()
+
+  if err := l.LockUpload("upload-1"); err != nil {
+    t.Fatalf("LockUpload: unexpected error: %s", err)
+  }
+  l.Shutdown()
+
+  if err := l.LockUpload("upload-1"); err != nil {
+    t.Fatalf("LockUpload after Shutdown: unexpected error: %s", err)
+  }
+}
@@ -0,0 +1,97 @@
+// Package metrics wraps a Prometheus registry with the counters tusc-s5
+// exposes about upload activity and the HTTP connections serving it.
+package metrics
+
+import (
+  "github.com/prometheus/client_golang/prometheus"
+  "github.com/prometheus/client_golang/prometheus/promhttp"
+  "net"
+  "net/http"
+)
+
+// Metrics holds the counters tusc-s5 reports under --expose-metrics.
+type Metrics struct {
+  registry *prometheus.Registry
+
+  UploadsCreated    prometheus.Counter
+  UploadsCompleted  prometheus.Counter
+  UploadsTerminated prometheus.Counter
+  BytesUploaded     prometheus.Counter
+  OpenConnections   prometheus.Gauge
+}
+
+// New creates a Metrics instance with all counters registered on their own
+// registry, so /metrics only ever exposes tusc-s5's own series.
+func New() *Metrics {
+  registry := prometheus.NewRegistry()
+
+  m := &Metrics{
+    registry: registry,
+    UploadsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+      Name: "tusc_s5_uploads_created_total",
+      Help: "Number of uploads created.",
+    }),
+    UploadsCompleted: prometheus.NewCounter(prometheus.CounterOpts{
+      Name: "tusc_s5_uploads_completed_total",
+      Help: "Number of uploads that finished successfully.",
+    }),
+    UploadsTerminated: prometheus.NewCounter(prometheus.CounterOpts{
+      Name: "tusc_s5_uploads_terminated_total",
+      Help: "Number of uploads terminated before completion.",
+    }),
+    BytesUploaded: prometheus.NewCounter(prometheus.CounterOpts{
+      Name: "tusc_s5_bytes_uploaded_total",
+      Help: "Total number of bytes received across all uploads.",
+    }),
+    OpenConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+      Name: "tusc_s5_open_connections",
+      Help: "Number of currently open HTTP connections.",
+    }),
+  }
+
+  registry.MustRegister(
+    m.UploadsCreated,
+    m.UploadsCompleted,
+    m.UploadsTerminated,
+    m.BytesUploaded,
+    m.OpenConnections,
+  )
+
+  return m
+}
+
+// Handler returns the HTTP handler to mount at --metrics-path.
+func (m *Metrics) Handler() http.Handler {
+  return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// WrapListener wraps l so that every accepted connection increments
+// OpenConnections until it is closed.
+func (m *Metrics) WrapListener(l net.Listener) net.Listener {
+  return &instrumentedListener{Listener: l, metrics: m}
+}
+
+type instrumentedListener struct {
+  net.Listener
+  metrics *Metrics
+}
+
+func (l *instrumentedListener) Accept() (net.Conn, error) {
+  conn, err := l.Listener.Accept()
+  if err != nil {
+    return nil, err
+  }
+  l.metrics.OpenConnections.Inc()
+  return &instrumentedConn{Conn: conn, metrics: l.metrics}, nil
+}
+
+type instrumentedConn struct {
+  net.Conn
+  metrics *Metrics
+}
+
+func (c *instrumentedConn) Close() error {
+  err := c.Conn.Close()
+  c.metrics.OpenConnections.Dec()
+  return err
+}
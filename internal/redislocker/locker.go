@@ -0,0 +1,196 @@
+// Package redislocker implements a tusd.Locker backed by Redis, so that
+// multiple tusc-s5 instances can run behind a load balancer against a
+// shared filestore/s5store backend without corrupting concurrent uploads.
+package redislocker
+
+import (
+  "crypto/rand"
+  "encoding/hex"
+  "fmt"
+  "github.com/go-redis/redis"
+  "github.com/tus/tusd"
+  "log"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+// releaseScript deletes key only if it still holds token, so a lock whose
+// lease already expired and was re-acquired by someone else is never
+// released out from under them.
+var releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+  return redis.call("del", KEYS[1])
+else
+  return 0
+end
+`)
+
+// RedisLocker is a tusd.Locker that leases locks in Redis with SET NX PX,
+// refreshing the lease in the background for as long as the lock is held.
+type RedisLocker struct {
+  client *redis.Client
+  prefix string
+  lease  time.Duration
+
+  mutex sync.Mutex
+  held  map[string]heldLock
+}
+
+// heldLock tracks the refresher goroutine and token for a lock this
+// instance currently holds, so it can be released safely.
+type heldLock struct {
+  token string
+  stop  chan struct{}
+  // invalid is set to 1 by refresh once it can no longer vouch for the
+  // lease: either it was stolen by another holder, or enough renewals in a
+  // row failed that the lease has plausibly expired on its own. UnlockUpload
+  // checks it so callers learn their hold on id may already be gone instead
+  // of assuming the release succeeded.
+  invalid *int32
+}
+
+// New connects to the Redis instance at addr and returns a ready to use
+// RedisLocker whose locks are leased for lease before needing renewal.
+func New(addr string, lease time.Duration) (*RedisLocker, error) {
+  client := redis.NewClient(&redis.Options{Addr: addr})
+  if err := client.Ping().Err(); err != nil {
+    return nil, fmt.Errorf("redislocker: unable to reach redis at %s: %s", addr, err)
+  }
+
+  return &RedisLocker{
+    client: client,
+    prefix: "tusc-s5:lock:",
+    lease:  lease,
+    held:   make(map[string]heldLock),
+  }, nil
+}
+
+// UseIn registers this locker as composer's Locker.
+func (l *RedisLocker) UseIn(composer *tusd.StoreComposer) {
+  composer.UseLocker(l)
+}
+
+func (l *RedisLocker) key(id string) string {
+  return l.prefix + id
+}
+
+// LockUpload acquires a lease for id in Redis and starts a goroutine that
+// refreshes it until UnlockUpload is called. If Redis is unreachable or the
+// lease is already held elsewhere, it returns tusd.ErrFileLocked.
+func (l *RedisLocker) LockUpload(id string) error {
+  token, err := randomToken()
+  if err != nil {
+    return err
+  }
+
+  ok, err := l.client.SetNX(l.key(id), token, l.lease).Result()
+  if err != nil {
+    return tusd.ErrFileLocked
+  }
+  if !ok {
+    return tusd.ErrFileLocked
+  }
+
+  stop := make(chan struct{})
+  invalid := new(int32)
+  l.mutex.Lock()
+  l.held[id] = heldLock{token: token, stop: stop, invalid: invalid}
+  l.mutex.Unlock()
+
+  go l.refresh(id, token, stop, invalid)
+  return nil
+}
+
+// extendScript renews key's lease, but only if it's still held by token, so
+// a lease that already expired and was re-acquired elsewhere is left alone.
+var extendScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+  return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+  return 0
+end
+`)
+
+// refresh keeps extending the lease on id's key until stop is closed, so a
+// long-running upload doesn't lose its lock mid-way through. If renewals
+// start failing (a dropped Redis connection, say) it keeps retrying rather
+// than giving up after one miss, since a single blip shouldn't cost the
+// lock; but once enough time has passed without a confirmed renewal that
+// the lease has plausibly expired on its own, it marks the hold invalid and
+// stops, so UnlockUpload can fail loudly instead of releasing a key that
+// another instance may have already reacquired.
+func (l *RedisLocker) refresh(id, token string, stop chan struct{}, invalid *int32) {
+  ticker := time.NewTicker(l.lease / 2)
+  defer ticker.Stop()
+
+  lastRenewed := time.Now()
+  for {
+    select {
+    case <-ticker.C:
+      renewed, err := extendScript.Run(l.client, []string{l.key(id)}, token, l.lease.Milliseconds()).Result()
+      if err != nil {
+        log.Printf("redislocker: failed to renew lease for %s: %s", id, err)
+        if time.Since(lastRenewed) >= l.lease {
+          log.Printf("redislocker: lease for %s has likely expired without a confirmed renewal, no longer vouching for the hold", id)
+          atomic.StoreInt32(invalid, 1)
+          return
+        }
+        continue
+      }
+      if renewed == int64(0) {
+        log.Printf("redislocker: lease for %s was already reacquired by another holder", id)
+        atomic.StoreInt32(invalid, 1)
+        return
+      }
+      lastRenewed = time.Now()
+    case <-stop:
+      return
+    }
+  }
+}
+
+// UnlockUpload stops refreshing id's lease and releases it in Redis,
+// provided it's still held by this process. If refresh already gave up on
+// id's lease (renewals kept failing until it plausibly expired, or another
+// instance won it first), it returns tusd.ErrFileLocked instead of
+// pretending the release succeeded, since this instance can no longer
+// vouch for exclusive ownership of id.
+func (l *RedisLocker) UnlockUpload(id string) error {
+  l.mutex.Lock()
+  lock, ok := l.held[id]
+  delete(l.held, id)
+  l.mutex.Unlock()
+
+  if !ok {
+    return nil
+  }
+  close(lock.stop)
+  if atomic.LoadInt32(lock.invalid) != 0 {
+    return tusd.ErrFileLocked
+  }
+  return releaseScript.Run(l.client, []string{l.key(id)}, lock.token).Err()
+}
+
+// Shutdown stops refreshing and releases every lock this instance currently
+// holds. It should be called while draining in-flight requests so another
+// instance can immediately pick up any upload this one was serving.
+func (l *RedisLocker) Shutdown() {
+  l.mutex.Lock()
+  locks := l.held
+  l.held = make(map[string]heldLock)
+  l.mutex.Unlock()
+
+  for id, lock := range locks {
+    close(lock.stop)
+    releaseScript.Run(l.client, []string{l.key(id)}, lock.token)
+  }
+}
+
+func randomToken() (string, error) {
+  buf := make([]byte, 16)
+  if _, err := rand.Read(buf); err != nil {
+    return "", err
+  }
+  return hex.EncodeToString(buf), nil
+}
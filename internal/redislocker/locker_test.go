@@ -0,0 +1,181 @@
+package redislocker
+
+import (
+  "os"
+  "sync"
+  "testing"
+  "time"
+
+  "github.com/tus/tusd"
+)
+
+// testRedisAddr lets CI point these tests at a real Redis instance via
+// REDISLOCKER_TEST_ADDR, defaulting to localhost:6379. A test is skipped when
+// no Redis answers at that address, since RedisLocker has no in-process fake
+// to exercise the SET NX PX / lease-expiry logic against.
+func testRedisAddr() string {
+  if addr := os.Getenv("REDISLOCKER_TEST_ADDR"); addr != "" {
+    return addr
+  }
+  return "localhost:6379"
+}
+
+func newTestLocker(t *testing.T, lease time.Duration) *RedisLocker {
+  t.Helper()
+  l, err := New(testRedisAddr(), lease)
+  if err != nil {
+    t.Skipf("skipping: no redis reachable at %s: %s", testRedisAddr(), err)
+  }
+  return l
+}
+
+func TestLockUnlock(t *testing.T) {
+  l := newTestLocker(t, time.Second)
+  id := "upload-lock-unlock"
+  defer l.client.Del(l.key(id))
+
+  if err := l.LockUpload(id); err != nil {
+    t.Fatalf("LockUpload: unexpected error: %s", err)
+  }
+  if err := l.UnlockUpload(id); err != nil {
+    t.Fatalf("UnlockUpload: unexpected error: %s", err)
+  }
+  if err := l.LockUpload(id); err != nil {
+    t.Fatalf("LockUpload after unlock: unexpected error: %s", err)
+  }
+  l.UnlockUpload(id)
+}
+
+func TestLockUploadAlreadyLocked(t *testing.T) {
+  l := newTestLocker(t, time.Second)
+  id := "upload-already-locked"
+  defer l.client.Del(l.key(id))
+
+  if err := l.LockUpload(id); err != nil {
+    t.Fatalf("LockUpload: unexpected error: %s", err)
+  }
+  defer l.UnlockUpload(id)
+
+  if err := l.LockUpload(id); err == nil {
+    t.Fatal("LockUpload: expected error locking an already-held upload, got nil")
+  }
+}
+
+// TestConcurrentLockUpload races many goroutines against LockUpload for the
+// same upload ID: exactly one must win the underlying SET NX. Run with
+// -race to catch any data race in the held-lock bookkeeping.
+func TestConcurrentLockUpload(t *testing.T) {
+  l := newTestLocker(t, time.Second)
+  id := "upload-concurrent"
+  defer l.client.Del(l.key(id))
+
+  const attempts = 20
+  var wins int32
+  var mu sync.Mutex
+  var wg sync.WaitGroup
+
+  for i := 0; i < attempts; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      if err := l.LockUpload(id); err == nil {
+        mu.Lock()
+        wins++
+        mu.Unlock()
+      }
+    }()
+  }
+  wg.Wait()
+
+  if wins != 1 {
+    t.Fatalf("expected exactly 1 goroutine to acquire the lock, got %d", wins)
+  }
+  l.UnlockUpload(id)
+}
+
+// TestLeaseExpiryAllowsReacquire confirms that once a lease expires without
+// being refreshed (e.g. the holder crashed), another caller can acquire it.
+func TestLeaseExpiryAllowsReacquire(t *testing.T) {
+  lease := 50 * time.Millisecond
+  l := newTestLocker(t, lease)
+  id := "upload-lease-expiry"
+  defer l.client.Del(l.key(id))
+
+  token, err := randomToken()
+  if err != nil {
+    t.Fatalf("randomToken: unexpected error: %s", err)
+  }
+  if err := l.client.SetNX(l.key(id), token, lease).Err(); err != nil {
+    t.Fatalf("seeding expired lease: unexpected error: %s", err)
+  }
+
+  time.Sleep(2 * lease)
+
+  if err := l.LockUpload(id); err != nil {
+    t.Fatalf("LockUpload after lease expiry: unexpected error: %s", err)
+  }
+  l.UnlockUpload(id)
+}
+
+// TestRefreshFailureMarksHoldInvalid confirms that a "held" lease whose
+// refresher can no longer confirm it still owns the key - here simulated by
+// another party deleting the key out from under it, the same symptom a
+// dropped Redis connection produces once the lease has expired server-side -
+// causes UnlockUpload to fail loudly with tusd.ErrFileLocked instead of
+// silently reporting success for a lock it may no longer hold.
+func TestRefreshFailureMarksHoldInvalid(t *testing.T) {
+  lease := 50 * time.Millisecond
+  l := newTestLocker(t, lease)
+  id := "upload-refresh-failure"
+  defer l.client.Del(l.key(id))
+
+  if err := l.LockUpload(id); err != nil {
+    t.Fatalf("LockUpload: unexpected error: %s", err)
+  }
+
+  if err := l.client.Del(l.key(id)).Err(); err != nil {
+    t.Fatalf("simulating lost key: unexpected error: %s", err)
+  }
+
+  time.Sleep(2 * lease)
+
+  if err := l.UnlockUpload(id); err != tusd.ErrFileLocked {
+    t.Fatalf("UnlockUpload after refresh failure: got %v, want tusd.ErrFileLocked", err)
+  }
+}
+
+// TestUnlockDoesNotReleaseReacquiredLease confirms releaseScript's token
+// check: unlocking with a stale token must not delete a lease someone else
+// re-acquired after ours expired.
+func TestUnlockDoesNotReleaseReacquiredLease(t *testing.T) {
+  l := newTestLocker(t, time.Second)
+  id := "upload-stale-unlock"
+  defer l.client.Del(l.key(id))
+
+  if err := l.LockUpload(id); err != nil {
+    t.Fatalf("LockUpload: unexpected error: %s", err)
+  }
+  staleToken := l.held[id].token
+  close(l.held[id].stop)
+
+  // Simulate someone else re-acquiring the key with a different token.
+  newToken, err := randomToken()
+  if err != nil {
+    t.Fatalf("randomToken: unexpected error: %s", err)
+  }
+  if err := l.client.Set(l.key(id), newToken, time.Second).Err(); err != nil {
+    t.Fatalf("simulating re-acquire: unexpected error: %s", err)
+  }
+
+  if err := releaseScript.Run(l.client, []string{l.key(id)}, staleToken).Err(); err != nil {
+    t.Fatalf("releaseScript: unexpected error: %s", err)
+  }
+
+  got, err := l.client.Get(l.key(id)).Result()
+  if err != nil {
+    t.Fatalf("Get: unexpected error: %s", err)
+  }
+  if got != newToken {
+    t.Fatalf("stale unlock released a lease it didn't hold: key now %q, want %q", got, newToken)
+  }
+}
@@ -0,0 +1,437 @@
+// Package s5store implements a tusd.DataStore backed by an S5 portal. Each
+// upload is streamed to the portal as it arrives; once the final chunk has
+// been written the resulting content is pinned and its CID is recorded
+// against the upload so the listing page and API clients can link straight
+// to it.
+package s5store
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "github.com/tus/tusd"
+  "io"
+  "net/http"
+  "net/url"
+  "strings"
+  "time"
+)
+
+// Config holds the parameters needed to talk to an S5 portal.
+type Config struct {
+  // PortalURL is the base URL of the S5 portal, e.g. "https://s5.example.com".
+  PortalURL string
+  // AuthToken is sent as a bearer token on every request to the portal, if set.
+  AuthToken string
+  // ObjectPrefix is prepended to every object key this store writes, so that
+  // multiple tusc-s5 instances can safely share one portal.
+  ObjectPrefix string
+  // Timeout bounds every request this store makes to the portal. GetInfo's
+  // finish/pin retry (see tryFinishUpload) already turns one read into up
+  // to four portal round trips, so a slow or unreachable portal shouldn't
+  // be able to multiply that into an indefinite hang. Zero means no timeout.
+  Timeout time.Duration
+}
+
+// S5Store is a tusd.DataStore that streams uploads to an S5 portal.
+type S5Store struct {
+  Config
+  client *http.Client
+}
+
+// New validates cfg and returns a ready to use S5Store.
+func New(cfg Config) (*S5Store, error) {
+  if cfg.PortalURL == "" {
+    return nil, errors.New("s5store: PortalURL must not be empty")
+  }
+  cfg.PortalURL = strings.TrimRight(cfg.PortalURL, "/")
+
+  return &S5Store{
+    Config: cfg,
+    client: &http.Client{Timeout: cfg.Timeout},
+  }, nil
+}
+
+// UseIn registers this store as the core, terminater, concater and length
+// deferrer of composer, mirroring how filestore.FileStore wires itself up.
+func (s *S5Store) UseIn(composer *tusd.StoreComposer) {
+  composer.UseCore(s)
+  composer.UseTerminater(s)
+  composer.UseConcater(s)
+  composer.UseLengthDeferrer(s)
+}
+
+func (s *S5Store) objectKey(id, suffix string) string {
+  return s.ObjectPrefix + id + suffix
+}
+
+func (s *S5Store) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+  req, err := http.NewRequest(method, s.PortalURL+path, body)
+  if err != nil {
+    return nil, err
+  }
+  if s.AuthToken != "" {
+    req.Header.Set("Authorization", "Bearer "+s.AuthToken)
+  }
+  return req, nil
+}
+
+// NewUpload opens an upload session on the portal and writes the initial
+// .info sidecar object so GetInfo works even before the first byte arrives.
+func (s *S5Store) NewUpload(info tusd.FileInfo) (string, error) {
+  req, err := s.newRequest(http.MethodPost, "/s5/upload/new", nil)
+  if err != nil {
+    return "", err
+  }
+  resp, err := s.client.Do(req)
+  if err != nil {
+    return "", fmt.Errorf("s5store: unable to open upload session: %s", err)
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return "", fmt.Errorf("s5store: portal returned %s opening upload session", resp.Status)
+  }
+
+  var created struct {
+    ID string `json:"id"`
+  }
+  if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+    return "", fmt.Errorf("s5store: unable to decode upload session response: %s", err)
+  }
+
+  info.ID = created.ID
+  info.Storage = map[string]string{
+    "Type":    "s5store",
+    "Portal":  s.PortalURL,
+    "Session": created.ID,
+  }
+
+  return info.ID, s.SetInfo(info)
+}
+
+// WriteChunk streams src to the portal's blob API at the given offset and,
+// once the upload is complete, finalizes it by pinning the resulting CID.
+func (s *S5Store) WriteChunk(id string, offset int64, src io.Reader) (int64, error) {
+  info, err := s.GetInfo(id)
+  if err != nil {
+    return 0, err
+  }
+
+  session := info.Storage["Session"]
+  path := fmt.Sprintf("/s5/upload/%s/chunk?offset=%d", url.PathEscape(session), offset)
+  req, err := s.newRequest(http.MethodPut, path, src)
+  if err != nil {
+    return 0, err
+  }
+
+  resp, err := s.client.Do(req)
+  if err != nil {
+    return 0, fmt.Errorf("s5store: unable to write chunk: %s", err)
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return 0, fmt.Errorf("s5store: portal returned %s writing chunk", resp.Status)
+  }
+
+  var written struct {
+    BytesWritten int64 `json:"bytesWritten"`
+  }
+  if err := json.NewDecoder(resp.Body).Decode(&written); err != nil {
+    return 0, fmt.Errorf("s5store: unable to decode chunk response: %s", err)
+  }
+
+  info.Offset = offset + written.BytesWritten
+  if err := s.SetInfo(info); err != nil {
+    return written.BytesWritten, err
+  }
+
+  if !info.IsPartial && !info.SizeIsDeferred && info.Offset == info.Size {
+    if err := s.finishUpload(info); err != nil {
+      return written.BytesWritten, err
+    }
+  }
+
+  return written.BytesWritten, nil
+}
+
+// finishUpload tells the portal the upload session is complete, pins the
+// resulting CID and records it against the upload so it can be served and
+// linked to. Until it succeeds, the upload keeps no CID, so GetInfo retries
+// it on every call.
+func (s *S5Store) finishUpload(info tusd.FileInfo) error {
+  _, err := s.tryFinishUpload(info)
+  return err
+}
+
+// tryFinishUpload is finishUpload's implementation, returning the info as
+// persisted with its new CID/URL so callers that already have a copy of
+// info in hand (GetInfo's retry path) don't need to re-fetch it.
+func (s *S5Store) tryFinishUpload(info tusd.FileInfo) (tusd.FileInfo, error) {
+  session := info.Storage["Session"]
+  req, err := s.newRequest(http.MethodPost, fmt.Sprintf("/s5/upload/%s/finish", url.PathEscape(session)), nil)
+  if err != nil {
+    return info, err
+  }
+
+  resp, err := s.client.Do(req)
+  if err != nil {
+    return info, fmt.Errorf("s5store: unable to finish upload: %s", err)
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return info, fmt.Errorf("s5store: portal returned %s finishing upload", resp.Status)
+  }
+
+  var finished struct {
+    CID string `json:"cid"`
+  }
+  if err := json.NewDecoder(resp.Body).Decode(&finished); err != nil {
+    return info, fmt.Errorf("s5store: unable to decode finish response: %s", err)
+  }
+
+  pinReq, err := s.newRequest(http.MethodPost, "/s5/pins/"+finished.CID, nil)
+  if err != nil {
+    return info, err
+  }
+  pinResp, err := s.client.Do(pinReq)
+  if err != nil {
+    return info, fmt.Errorf("s5store: unable to pin %s: %s", finished.CID, err)
+  }
+  defer pinResp.Body.Close()
+  if pinResp.StatusCode != http.StatusOK {
+    return info, fmt.Errorf("s5store: portal returned %s pinning %s", pinResp.Status, finished.CID)
+  }
+
+  info.Storage["CID"] = finished.CID
+  info.Storage["URL"] = s.PortalURL + "/s5/blobs/" + finished.CID
+  if err := s.SetInfo(info); err != nil {
+    return info, err
+  }
+  return info, nil
+}
+
+// GetInfo fetches the .info sidecar object for id from the portal.
+func (s *S5Store) GetInfo(id string) (tusd.FileInfo, error) {
+  req, err := s.newRequest(http.MethodGet, "/s5/objects/"+url.PathEscape(s.objectKey(id, ".info")), nil)
+  if err != nil {
+    return tusd.FileInfo{}, err
+  }
+
+  resp, err := s.client.Do(req)
+  if err != nil {
+    return tusd.FileInfo{}, fmt.Errorf("s5store: unable to fetch info: %s", err)
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode == http.StatusNotFound {
+    return tusd.FileInfo{}, tusd.ErrNotFound
+  }
+  if resp.StatusCode != http.StatusOK {
+    return tusd.FileInfo{}, fmt.Errorf("s5store: portal returned %s fetching info", resp.Status)
+  }
+
+  var info tusd.FileInfo
+  if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+    return tusd.FileInfo{}, fmt.Errorf("s5store: unable to decode info: %s", err)
+  }
+
+  // WriteChunk may have persisted Offset == Size without finishUpload
+  // actually completing (the portal could be unreachable for the finish/pin
+  // calls). Retry it here so a byte-complete upload isn't stuck forever
+  // with no CID and no further chunks for the client to PATCH.
+  if !info.IsPartial && !info.SizeIsDeferred && info.Offset == info.Size && info.Storage["CID"] == "" && info.Storage["Session"] != "" {
+    if finished, err := s.tryFinishUpload(info); err == nil {
+      info = finished
+    }
+  }
+
+  return info, nil
+}
+
+// SetInfo persists the .info sidecar object for info.ID on the portal.
+func (s *S5Store) SetInfo(info tusd.FileInfo) error {
+  body, err := json.Marshal(info)
+  if err != nil {
+    return err
+  }
+
+  req, err := s.newRequest(http.MethodPut, "/s5/objects/"+url.PathEscape(s.objectKey(info.ID, ".info")), bytes.NewReader(body))
+  if err != nil {
+    return err
+  }
+  req.Header.Set("Content-Type", "application/json")
+  req.ContentLength = int64(len(body))
+
+  resp, err := s.client.Do(req)
+  if err != nil {
+    return fmt.Errorf("s5store: unable to persist info: %s", err)
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return fmt.Errorf("s5store: portal returned %s persisting info", resp.Status)
+  }
+  return nil
+}
+
+// GetReader streams the finished blob's content from the portal. It returns
+// an error if the upload has not finished yet, since no CID exists until then.
+func (s *S5Store) GetReader(id string) (io.Reader, error) {
+  info, err := s.GetInfo(id)
+  if err != nil {
+    return nil, err
+  }
+
+  cid := info.Storage["CID"]
+  if cid == "" {
+    return nil, errors.New("s5store: upload is not finished yet, no CID available")
+  }
+
+  req, err := s.newRequest(http.MethodGet, "/s5/blobs/"+cid, nil)
+  if err != nil {
+    return nil, err
+  }
+  resp, err := s.client.Do(req)
+  if err != nil {
+    return nil, fmt.Errorf("s5store: unable to fetch blob %s: %s", cid, err)
+  }
+  if resp.StatusCode != http.StatusOK {
+    resp.Body.Close()
+    return nil, fmt.Errorf("s5store: portal returned %s fetching blob %s", resp.Status, cid)
+  }
+  return resp.Body, nil
+}
+
+// Terminate unpins the finished blob, or aborts the upload session if no CID
+// has been recorded yet, and deletes the .info sidecar object from the portal.
+func (s *S5Store) Terminate(id string) error {
+  info, err := s.GetInfo(id)
+  if err != nil {
+    return err
+  }
+
+  if cid := info.Storage["CID"]; cid != "" {
+    req, err := s.newRequest(http.MethodDelete, "/s5/pins/"+cid, nil)
+    if err != nil {
+      return err
+    }
+    resp, err := s.client.Do(req)
+    if err != nil {
+      return fmt.Errorf("s5store: unable to unpin %s: %s", cid, err)
+    }
+    resp.Body.Close()
+  } else if session := info.Storage["Session"]; session != "" {
+    req, err := s.newRequest(http.MethodDelete, "/s5/upload/"+url.PathEscape(session), nil)
+    if err != nil {
+      return err
+    }
+    resp, err := s.client.Do(req)
+    if err != nil {
+      return fmt.Errorf("s5store: unable to abort upload session %s: %s", session, err)
+    }
+    resp.Body.Close()
+  }
+
+  req, err := s.newRequest(http.MethodDelete, "/s5/objects/"+url.PathEscape(s.objectKey(id, ".info")), nil)
+  if err != nil {
+    return err
+  }
+  resp, err := s.client.Do(req)
+  if err != nil {
+    return fmt.Errorf("s5store: unable to delete info: %s", err)
+  }
+  resp.Body.Close()
+  return nil
+}
+
+// ConcatUploads is used for parallel uploads: it tells the portal to
+// concatenate the already-uploaded partial blobs into dest, in order, and
+// finishes dest the same way a regular upload finishes.
+func (s *S5Store) ConcatUploads(dest string, partialIDs []string) error {
+  destInfo, err := s.GetInfo(dest)
+  if err != nil {
+    return err
+  }
+
+  sessions := make([]string, 0, len(partialIDs))
+  for _, id := range partialIDs {
+    partial, err := s.GetInfo(id)
+    if err != nil {
+      return err
+    }
+    sessions = append(sessions, partial.Storage["Session"])
+  }
+
+  body, err := json.Marshal(struct {
+    Sessions []string `json:"sessions"`
+  }{Sessions: sessions})
+  if err != nil {
+    return err
+  }
+
+  session := destInfo.Storage["Session"]
+  req, err := s.newRequest(http.MethodPost, fmt.Sprintf("/s5/upload/%s/concat", url.PathEscape(session)), bytes.NewReader(body))
+  if err != nil {
+    return err
+  }
+  req.Header.Set("Content-Type", "application/json")
+
+  resp, err := s.client.Do(req)
+  if err != nil {
+    return fmt.Errorf("s5store: unable to concatenate uploads: %s", err)
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return fmt.Errorf("s5store: portal returned %s concatenating uploads", resp.Status)
+  }
+
+  destInfo.Offset = destInfo.Size
+  return s.finishUpload(destInfo)
+}
+
+// DeclareLength sets the final size of an upload whose length was deferred
+// at creation time, as required by the creation-defer-length extension.
+func (s *S5Store) DeclareLength(id string, length int64) error {
+  info, err := s.GetInfo(id)
+  if err != nil {
+    return err
+  }
+  info.Size = length
+  info.SizeIsDeferred = false
+  return s.SetInfo(info)
+}
+
+// ListUploads returns the FileInfo of every upload this store knows about,
+// for the listing page.
+func (s *S5Store) ListUploads() ([]tusd.FileInfo, error) {
+  req, err := s.newRequest(http.MethodGet, "/s5/objects?prefix="+url.QueryEscape(s.ObjectPrefix), nil)
+  if err != nil {
+    return nil, err
+  }
+  resp, err := s.client.Do(req)
+  if err != nil {
+    return nil, fmt.Errorf("s5store: unable to list objects: %s", err)
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return nil, fmt.Errorf("s5store: portal returned %s listing objects", resp.Status)
+  }
+
+  var keys []string
+  if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+    return nil, fmt.Errorf("s5store: unable to decode object list: %s", err)
+  }
+
+  var infos []tusd.FileInfo
+  for _, key := range keys {
+    if !strings.HasSuffix(key, ".info") {
+      continue
+    }
+    id := strings.TrimSuffix(strings.TrimPrefix(key, s.ObjectPrefix), ".info")
+    info, err := s.GetInfo(id)
+    if err != nil {
+      return nil, err
+    }
+    infos = append(infos, info)
+  }
+  return infos, nil
+}
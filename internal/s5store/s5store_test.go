@@ -0,0 +1,237 @@
+package s5store
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "sync"
+  "testing"
+
+  "github.com/tus/tusd"
+)
+
+// fakePortal is a minimal in-memory stand-in for an S5 portal: enough of
+// the upload/object/pin API for S5Store's calls to round-trip against, with
+// finishErr letting tests simulate the finish/pin endpoints being down.
+type fakePortal struct {
+  mu        sync.Mutex
+  objects   map[string][]byte
+  nextID    int
+  finishErr bool
+}
+
+func newFakePortal() *fakePortal {
+  return &fakePortal{objects: make(map[string][]byte)}
+}
+
+func (p *fakePortal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  p.mu.Lock()
+  defer p.mu.Unlock()
+
+  switch {
+  case r.URL.Path == "/s5/upload/new" && r.Method == http.MethodPost:
+    p.nextID++
+    id := fmt.Sprintf("upload%d", p.nextID)
+    json.NewEncoder(w).Encode(struct {
+      ID string `json:"id"`
+    }{ID: id})
+
+  case strings.HasSuffix(r.URL.Path, "/chunk") && r.Method == http.MethodPut:
+    body, _ := ioutil.ReadAll(r.Body)
+    json.NewEncoder(w).Encode(struct {
+      BytesWritten int64 `json:"bytesWritten"`
+    }{BytesWritten: int64(len(body))})
+
+  case strings.HasSuffix(r.URL.Path, "/finish") && r.Method == http.MethodPost:
+    if p.finishErr {
+      http.Error(w, "portal unreachable", http.StatusInternalServerError)
+      return
+    }
+    json.NewEncoder(w).Encode(struct {
+      CID string `json:"cid"`
+    }{CID: "cid-" + strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/s5/upload/"), "/finish")})
+
+  case strings.HasSuffix(r.URL.Path, "/concat") && r.Method == http.MethodPost:
+    w.WriteHeader(http.StatusOK)
+
+  case strings.HasPrefix(r.URL.Path, "/s5/pins/"):
+    if r.Method == http.MethodPost && p.finishErr {
+      http.Error(w, "portal unreachable", http.StatusInternalServerError)
+      return
+    }
+    w.WriteHeader(http.StatusOK)
+
+  case r.URL.Path == "/s5/objects" && r.Method == http.MethodGet:
+    prefix := r.URL.Query().Get("prefix")
+    var keys []string
+    for key := range p.objects {
+      if strings.HasPrefix(key, prefix) {
+        keys = append(keys, key)
+      }
+    }
+    json.NewEncoder(w).Encode(keys)
+
+  case strings.HasPrefix(r.URL.Path, "/s5/objects/") && r.Method == http.MethodPut:
+    key := strings.TrimPrefix(r.URL.Path, "/s5/objects/")
+    body, _ := ioutil.ReadAll(r.Body)
+    p.objects[key] = body
+    w.WriteHeader(http.StatusOK)
+
+  case strings.HasPrefix(r.URL.Path, "/s5/objects/") && r.Method == http.MethodGet:
+    key := strings.TrimPrefix(r.URL.Path, "/s5/objects/")
+    body, ok := p.objects[key]
+    if !ok {
+      w.WriteHeader(http.StatusNotFound)
+      return
+    }
+    w.Write(body)
+
+  case strings.HasPrefix(r.URL.Path, "/s5/objects/") && r.Method == http.MethodDelete:
+    key := strings.TrimPrefix(r.URL.Path, "/s5/objects/")
+    delete(p.objects, key)
+    w.WriteHeader(http.StatusOK)
+
+  case strings.HasPrefix(r.URL.Path, "/s5/upload/") && r.Method == http.MethodDelete:
+    w.WriteHeader(http.StatusOK)
+
+  default:
+    w.WriteHeader(http.StatusNotFound)
+  }
+}
+
+func newTestStore(t *testing.T, portal *fakePortal) *S5Store {
+  t.Helper()
+  srv := httptest.NewServer(portal)
+  t.Cleanup(srv.Close)
+
+  store, err := New(Config{PortalURL: srv.URL})
+  if err != nil {
+    t.Fatalf("New: unexpected error: %s", err)
+  }
+  return store
+}
+
+// TestGetInfoRetriesFinishUploadAfterPreviousFailure confirms 8205cc2's
+// reconciliation path: a byte-complete upload whose finish+pin round trip
+// failed is retried by GetInfo once the portal is reachable again, instead
+// of being stuck forever with no CID.
+func TestGetInfoRetriesFinishUploadAfterPreviousFailure(t *testing.T) {
+  portal := newFakePortal()
+  store := newTestStore(t, portal)
+
+  id, err := store.NewUpload(tusd.FileInfo{Size: 5})
+  if err != nil {
+    t.Fatalf("NewUpload: unexpected error: %s", err)
+  }
+
+  info, err := store.GetInfo(id)
+  if err != nil {
+    t.Fatalf("GetInfo: unexpected error: %s", err)
+  }
+  // Simulate WriteChunk having persisted the final offset but never
+  // completing finishUpload (as if the portal dropped the finish/pin call).
+  info.Offset = info.Size
+  if err := store.SetInfo(info); err != nil {
+    t.Fatalf("SetInfo: unexpected error: %s", err)
+  }
+
+  portal.finishErr = true
+  info, err = store.GetInfo(id)
+  if err != nil {
+    t.Fatalf("GetInfo while portal is down: unexpected error: %s", err)
+  }
+  if cid := info.Storage["CID"]; cid != "" {
+    t.Fatalf("GetInfo while portal is down: got CID %q, want none", cid)
+  }
+
+  portal.finishErr = false
+  info, err = store.GetInfo(id)
+  if err != nil {
+    t.Fatalf("GetInfo after portal recovers: unexpected error: %s", err)
+  }
+  if cid := info.Storage["CID"]; cid == "" {
+    t.Fatal("GetInfo after portal recovers: expected a CID to have been assigned")
+  }
+}
+
+// TestGetInfoDoesNotRetryFinishForIncompleteUpload confirms the retry only
+// fires once Offset has caught up with Size.
+func TestGetInfoDoesNotRetryFinishForIncompleteUpload(t *testing.T) {
+  portal := newFakePortal()
+  // finish/pin succeed, so a mistaken call from GetInfo would assign a CID.
+  store := newTestStore(t, portal)
+
+  id, err := store.NewUpload(tusd.FileInfo{Size: 5})
+  if err != nil {
+    t.Fatalf("NewUpload: unexpected error: %s", err)
+  }
+
+  info, err := store.GetInfo(id)
+  if err != nil {
+    t.Fatalf("GetInfo: unexpected error: %s", err)
+  }
+  if cid := info.Storage["CID"]; cid != "" {
+    t.Fatalf("GetInfo: got CID %q for an upload with Offset 0, want none", cid)
+  }
+}
+
+func TestConcatUploadsFinishesDest(t *testing.T) {
+  portal := newFakePortal()
+  store := newTestStore(t, portal)
+
+  dest, err := store.NewUpload(tusd.FileInfo{Size: 10})
+  if err != nil {
+    t.Fatalf("NewUpload(dest): unexpected error: %s", err)
+  }
+  var partials []string
+  for i := 0; i < 2; i++ {
+    id, err := store.NewUpload(tusd.FileInfo{Size: 5, IsPartial: true})
+    if err != nil {
+      t.Fatalf("NewUpload(partial %d): unexpected error: %s", i, err)
+    }
+    partials = append(partials, id)
+  }
+
+  if err := store.ConcatUploads(dest, partials); err != nil {
+    t.Fatalf("ConcatUploads: unexpected error: %s", err)
+  }
+
+  info, err := store.GetInfo(dest)
+  if err != nil {
+    t.Fatalf("GetInfo(dest): unexpected error: %s", err)
+  }
+  if info.Offset != info.Size {
+    t.Fatalf("GetInfo(dest): Offset = %d, want %d", info.Offset, info.Size)
+  }
+  if cid := info.Storage["CID"]; cid == "" {
+    t.Fatal("GetInfo(dest): expected ConcatUploads to have finished and pinned dest")
+  }
+}
+
+func TestDeclareLength(t *testing.T) {
+  portal := newFakePortal()
+  store := newTestStore(t, portal)
+
+  id, err := store.NewUpload(tusd.FileInfo{SizeIsDeferred: true})
+  if err != nil {
+    t.Fatalf("NewUpload: unexpected error: %s", err)
+  }
+
+  if err := store.DeclareLength(id, 42); err != nil {
+    t.Fatalf("DeclareLength: unexpected error: %s", err)
+  }
+
+  info, err := store.GetInfo(id)
+  if err != nil {
+    t.Fatalf("GetInfo: unexpected error: %s", err)
+  }
+  if info.Size != 42 {
+    t.Fatalf("GetInfo: Size = %d, want 42", info.Size)
+  }
+  if info.SizeIsDeferred {
+    t.Fatal("GetInfo: SizeIsDeferred is still true after DeclareLength")
+  }
+}
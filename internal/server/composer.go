@@ -0,0 +1,51 @@
+package server
+
+import (
+  "github.com/LumeWeb/tusc-s5/internal/s5store"
+  "github.com/tus/tusd"
+  "github.com/tus/tusd/filestore"
+  "github.com/tus/tusd/limitedstore"
+  "os"
+  "time"
+)
+
+// buildComposer wires up the StoreComposer according to conf.store, mirroring
+// the upstream tusd CLI's composer.go: every backend registers itself with
+// the composer and, if it wants to show up in the listing page, returns a
+// Lister as well.
+func buildComposer(conf ServerConf) (*tusd.StoreComposer, Lister, error) {
+  storeComposer := tusd.NewStoreComposer()
+
+  switch conf.store {
+  case storeKindS5:
+    stdout.Printf("Using S5 portal '%s' as storage backend.\n", conf.s5PortalURL)
+    store, err := s5store.New(s5store.Config{
+      PortalURL:    conf.s5PortalURL,
+      AuthToken:    conf.s5AuthToken,
+      ObjectPrefix: conf.s5ObjectPrefix,
+      Timeout:      time.Duration(conf.s5Timeout) * time.Millisecond,
+    })
+    if err != nil {
+      return nil, nil, err
+    }
+    store.UseIn(storeComposer)
+    return storeComposer, store, nil
+
+  case storeKindFile:
+    fallthrough
+  default:
+    stdout.Printf("Using '%s' as directory storage.\n", conf.uploadDir)
+    if err := os.MkdirAll(conf.uploadDir, os.FileMode(0774)); err != nil {
+      return nil, nil, err
+    }
+    store := filestore.New(conf.uploadDir)
+    store.UseIn(storeComposer)
+
+    if conf.storeSize > 0 {
+      limitedstore.New(conf.storeSize, storeComposer.Core, storeComposer.Terminater).UseIn(storeComposer)
+      stdout.Printf("Using %.2fMB as storage size.\n", float64(conf.storeSize)/1024/1024)
+    }
+
+    return storeComposer, fileStoreLister{store}, nil
+  }
+}
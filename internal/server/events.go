@@ -0,0 +1,75 @@
+package server
+
+import (
+  "github.com/LumeWeb/tusc-s5/internal/hooks"
+  "github.com/LumeWeb/tusc-s5/internal/metrics"
+  "github.com/tus/tusd"
+)
+
+// watchEvents drains handler's notification channels for as long as the
+// process runs, updating m and invoking h as configured. The channels are
+// only populated when the corresponding Notify* option is enabled on the
+// handler's Config, which Server() does whenever m or h is non-nil, except
+// for CreatedUploads, which it enables only when m is non-nil.
+//
+// Hooks are dispatched on their own goroutine rather than run inline: a slow
+// hook (an AV scan, say) must not stop this loop from draining the next
+// notification, since the handler's channels are unbuffered and a loop
+// that's stuck in a hook call would back up into unrelated PATCH/POST
+// requests server-wide.
+func watchEvents(handler *tusd.Handler, m *metrics.Metrics, h hooks.Handler) {
+  offsets := make(map[string]int64)
+
+  for {
+    select {
+    case info := <-handler.CreatedUploads:
+      if m != nil {
+        m.UploadsCreated.Inc()
+        offsets[info.ID] = 0
+      }
+
+    case info := <-handler.UploadProgress:
+      if m != nil {
+        if prev, ok := offsets[info.ID]; ok && info.Offset > prev {
+          m.BytesUploaded.Add(float64(info.Offset - prev))
+        }
+        offsets[info.ID] = info.Offset
+      }
+      if h != nil {
+        go invokeHook(h, hooks.PostReceive, info)
+      }
+
+    case info := <-handler.CompleteUploads:
+      if m != nil {
+        m.UploadsCompleted.Inc()
+        delete(offsets, info.ID)
+      }
+      if h != nil {
+        go invokeHook(h, hooks.PostFinish, info)
+      }
+
+    case info := <-handler.TerminatedUploads:
+      if m != nil {
+        m.UploadsTerminated.Inc()
+        delete(offsets, info.ID)
+      }
+      if h != nil {
+        go invokeHook(h, hooks.PostTerminate, info)
+      }
+    }
+  }
+}
+
+func invokeHook(h hooks.Handler, event hooks.Event, info tusd.FileInfo) {
+  payload := hooks.Payload{
+    Upload: hooks.Upload{
+      ID:       info.ID,
+      Size:     info.Size,
+      Offset:   info.Offset,
+      MetaData: info.MetaData,
+    },
+  }
+  if err := h.Invoke(event, payload); err != nil {
+    stderr.Printf("hooks: %s: %s", event, err)
+  }
+}
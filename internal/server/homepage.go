@@ -0,0 +1,127 @@
+package server
+
+import (
+  "github.com/tus/tusd"
+  "github.com/tus/tusd/filestore"
+  "html/template"
+  "io/ioutil"
+  "net/http"
+  "sort"
+)
+
+// Lister lets the listing page enumerate the uploads known to a backend
+// without the homepage handler needing to know which StoreComposer it is
+// talking to.
+type Lister interface {
+  ListUploads() ([]tusd.FileInfo, error)
+}
+
+// fileStoreLister adapts a filestore.FileStore, which keeps its uploads as
+// plain files on disk, to the Lister interface.
+type fileStoreLister struct {
+  store filestore.FileStore
+}
+
+func (l fileStoreLister) ListUploads() ([]tusd.FileInfo, error) {
+  fileInfos, err := ioutil.ReadDir(l.store.Path)
+  if err != nil {
+    return nil, err
+  }
+
+  var infos []tusd.FileInfo
+  for _, f := range fileInfos {
+    filename := f.Name()
+    const ext = ".info"
+    lenOfID := len(filename) - len(ext)
+
+    // only care about .info sidecar files
+    if lenOfID > 0 && filename[lenOfID:] == ext {
+      info, err := l.store.GetInfo(filename[:lenOfID])
+      if err != nil {
+        return nil, err
+      }
+      infos = append(infos, info)
+    }
+  }
+  return infos, nil
+}
+
+var homepageTemplate = template.Must(template.New("homepage").Parse(`{{define "listing"}}<html><head><title>File Listing</title><style>
+* {
+  font-family: monospace;
+  font-size: 18px;
+  box-sizing: border-box;
+}
+
+a {
+  text-decoration: none;
+}
+
+a:hover {
+  text-decoration: underline;
+}
+
+a:visited {
+  color: blue;
+}
+
+ul {
+  list-style-type: none;
+  margin: 0;
+  padding: 0;
+}
+
+li {
+  margin: 5px 10px;
+  padding: 0;
+}
+</style></head><body><ul>
+{{ range . }}<li><a href="{{ .URL }}">{{ .Name }}</a></li>{{ end }}
+  </ul>
+  </body>
+</html>{{end}}`))
+
+// listingEntry is what the homepage template renders: a display name paired
+// with wherever the file actually lives, whether that's this server's own
+// upload endpoint or a CID on an S5 portal.
+type listingEntry struct {
+  Name string
+  URL  string
+}
+
+func homepage(lister Lister, uploadURL string) http.HandlerFunc {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    infos, err := lister.ListUploads()
+    if err != nil {
+      http.Error(w, "", 500)
+      return
+    }
+
+    entries := make([]listingEntry, 0, len(infos))
+    for _, info := range infos {
+      entries = append(entries, listingEntry{
+        Name: info.MetaData["filename"],
+        URL:  downloadURL(info, uploadURL),
+      })
+    }
+    sort.Slice(entries, func(i, j int) bool {
+      return entries[i].Name < entries[j].Name
+    })
+
+    if err = homepageTemplate.ExecuteTemplate(w, "listing", entries); err != nil {
+      http.Error(w, "", 500)
+      return
+    }
+  })
+}
+
+// downloadURL returns the link the listing page should point at for a given
+// upload: its S5 CID URL once pinned, or the local tus endpoint otherwise.
+func downloadURL(info tusd.FileInfo, uploadURL string) string {
+  if info.Storage != nil {
+    if url := info.Storage["URL"]; url != "" {
+      return url
+    }
+  }
+  return uploadURL + info.ID
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+  "testing"
+
+  "github.com/tus/tusd"
+)
+
+func TestDownloadURLPrefersStorageURL(t *testing.T) {
+  info := tusd.FileInfo{
+    ID:      "abc123",
+    Storage: map[string]string{"URL": "https://portal.example/s5/blobs/cid123"},
+  }
+
+  got := downloadURL(info, "/files/")
+  want := "https://portal.example/s5/blobs/cid123"
+  if got != want {
+    t.Fatalf("downloadURL() = %q, want %q", got, want)
+  }
+}
+
+func TestDownloadURLFallsBackToUploadEndpoint(t *testing.T) {
+  tests := []struct {
+    name string
+    info tusd.FileInfo
+  }{
+    {name: "nil storage", info: tusd.FileInfo{ID: "abc123"}},
+    {name: "storage without URL", info: tusd.FileInfo{ID: "abc123", Storage: map[string]string{"CID": "cid123"}}},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      got := downloadURL(tt.info, "/files/")
+      want := "/files/abc123"
+      if got != want {
+        t.Fatalf("downloadURL() = %q, want %q", got, want)
+      }
+    })
+  }
+}
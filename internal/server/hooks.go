@@ -0,0 +1,74 @@
+package server
+
+import (
+  "encoding/base64"
+  "github.com/LumeWeb/tusc-s5/internal/hooks"
+  "net/http"
+  "strconv"
+  "strings"
+)
+
+// preCreateInterceptor wraps the tus handler so that a configured hook can
+// reject an upload before it's created: a POST to the creation endpoint is
+// parsed into a hooks.Payload and run through h.Invoke(hooks.PreCreate, ...)
+// first, and a 400 is returned to the client if that fails.
+func preCreateInterceptor(next http.Handler, h hooks.Handler, isBehindProxy bool) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if h == nil || r.Method != http.MethodPost {
+      next.ServeHTTP(w, r)
+      return
+    }
+
+    size, _ := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+    payload := hooks.Payload{
+      Upload: hooks.Upload{
+        Size:       size,
+        MetaData:   parseUploadMetadata(r.Header.Get("Upload-Metadata")),
+        RemoteAddr: remoteAddr(r, isBehindProxy),
+      },
+    }
+
+    if err := h.Invoke(hooks.PreCreate, payload); err != nil {
+      http.Error(w, err.Error(), http.StatusBadRequest)
+      return
+    }
+
+    next.ServeHTTP(w, r)
+  })
+}
+
+// parseUploadMetadata decodes the tus Upload-Metadata header, a
+// comma-separated list of "key base64(value)" pairs.
+func parseUploadMetadata(header string) map[string]string {
+  if header == "" {
+    return nil
+  }
+
+  meta := make(map[string]string)
+  for _, pair := range strings.Split(header, ",") {
+    parts := strings.SplitN(strings.TrimSpace(pair), " ", 2)
+    if len(parts) == 0 || parts[0] == "" {
+      continue
+    }
+    key := parts[0]
+    var value string
+    if len(parts) == 2 {
+      if decoded, err := base64.StdEncoding.DecodeString(parts[1]); err == nil {
+        value = string(decoded)
+      }
+    }
+    meta[key] = value
+  }
+  return meta
+}
+
+// remoteAddr returns the client address for r, honoring X-Forwarded-For
+// when isBehindProxy is set.
+func remoteAddr(r *http.Request, isBehindProxy bool) string {
+  if isBehindProxy {
+    if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+      return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+    }
+  }
+  return r.RemoteAddr
+}
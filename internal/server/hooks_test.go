@@ -0,0 +1,117 @@
+package server
+
+import (
+  "encoding/base64"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "reflect"
+  "testing"
+
+  "github.com/LumeWeb/tusc-s5/internal/hooks"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+  tests := []struct {
+    name   string
+    header string
+    want   map[string]string
+  }{
+    {name: "empty header", header: "", want: nil},
+    {
+      name:   "single pair",
+      header: "filename " + base64.StdEncoding.EncodeToString([]byte("report.pdf")),
+      want:   map[string]string{"filename": "report.pdf"},
+    },
+    {
+      name: "multiple pairs",
+      header: "filename " + base64.StdEncoding.EncodeToString([]byte("report.pdf")) +
+        ",filetype " + base64.StdEncoding.EncodeToString([]byte("application/pdf")),
+      want: map[string]string{"filename": "report.pdf", "filetype": "application/pdf"},
+    },
+    {
+      name:   "key with no value",
+      header: "isPrivate",
+      want:   map[string]string{"isPrivate": ""},
+    },
+    {
+      name:   "undecodable value is kept with an empty value",
+      header: "filename not-base64!!",
+      want:   map[string]string{"filename": ""},
+    },
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      got := parseUploadMetadata(tt.header)
+      if !reflect.DeepEqual(got, tt.want) {
+        t.Fatalf("parseUploadMetadata(%q) = %#v, want %#v", tt.header, got, tt.want)
+      }
+    })
+  }
+}
+
+type stubHookHandler struct {
+  err error
+}
+
+func (s stubHookHandler) Invoke(event hooks.Event, payload hooks.Payload) error {
+  return s.err
+}
+
+func TestPreCreateInterceptorRejectsOnHookError(t *testing.T) {
+  var called bool
+  next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    called = true
+  })
+
+  h := preCreateInterceptor(next, stubHookHandler{err: errors.New("rejected by policy")}, false)
+
+  req := httptest.NewRequest(http.MethodPost, "/files", nil)
+  rec := httptest.NewRecorder()
+  h.ServeHTTP(rec, req)
+
+  if called {
+    t.Fatal("preCreateInterceptor: next handler ran despite a failing hook")
+  }
+  if rec.Code != http.StatusBadRequest {
+    t.Fatalf("preCreateInterceptor: got status %d, want %d", rec.Code, http.StatusBadRequest)
+  }
+}
+
+func TestPreCreateInterceptorPassesThroughOnSuccess(t *testing.T) {
+  var called bool
+  next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    called = true
+  })
+
+  h := preCreateInterceptor(next, stubHookHandler{}, false)
+
+  req := httptest.NewRequest(http.MethodPost, "/files", nil)
+  rec := httptest.NewRecorder()
+  h.ServeHTTP(rec, req)
+
+  if !called {
+    t.Fatal("preCreateInterceptor: next handler did not run after a passing hook")
+  }
+}
+
+func TestPreCreateInterceptorIgnoresNonPostRequests(t *testing.T) {
+  var called bool
+  next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    called = true
+  })
+
+  h := preCreateInterceptor(next, stubHookHandler{err: errors.New("rejected by policy")}, false)
+
+  req := httptest.NewRequest(http.MethodPatch, "/files/abc", nil)
+  rec := httptest.NewRecorder()
+  h.ServeHTTP(rec, req)
+
+  if !called {
+    t.Fatal("preCreateInterceptor: next handler did not run for a non-POST request")
+  }
+  if rec.Code != http.StatusOK {
+    t.Fatalf("preCreateInterceptor: got status %d, want %d", rec.Code, http.StatusOK)
+  }
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+  "github.com/LumeWeb/tusc-s5/internal/memorylocker"
+  "github.com/LumeWeb/tusc-s5/internal/redislocker"
+  "github.com/tus/tusd"
+  "time"
+)
+
+const lockerKindRedis = "redis"
+
+// locker is what Server() needs from whichever locker backend it builds: it
+// registers itself on the composer, and can release everything it holds
+// when the server shuts down.
+type locker interface {
+  UseIn(composer *tusd.StoreComposer)
+  Shutdown()
+}
+
+// buildLocker always returns a locker, so two concurrent requests for the
+// same upload can never corrupt the backing store. --locker redis swaps the
+// default in-process MemoryLocker for a RedisLocker so multiple tusc-s5
+// instances can safely share one backend behind a load balancer.
+func buildLocker(conf ServerConf) (locker, error) {
+  if conf.locker != lockerKindRedis {
+    return memorylocker.New(), nil
+  }
+
+  stdout.Printf("Using redis at %s for upload locking.\n", conf.redisAddr)
+  return redislocker.New(conf.redisAddr, time.Duration(conf.redisLeaseMs)*time.Millisecond)
+}
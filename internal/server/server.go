@@ -0,0 +1,270 @@
+package server
+
+import (
+  "context"
+  "github.com/LumeWeb/tusc-s5/internal/hooks"
+  "github.com/LumeWeb/tusc-s5/internal/metrics"
+  "github.com/LumeWeb/tusc-s5/internal/util"
+  "github.com/docopt/docopt-go"
+  "github.com/tus/tusd"
+  "log"
+  "net"
+  "net/http"
+  "os"
+  "os/signal"
+  "syscall"
+  "time"
+)
+
+const (
+  storeKindFile = "file"
+  storeKindS5   = "s5"
+)
+
+const serverUsage = `tusc server
+
+Usage:
+  tusc (server|s) [options]
+  tusc (server|s) --help
+
+Options:
+  -h --host HOST                  Host to bind HTTP server to [default: 0.0.0.0]
+  -p --port PORT                  Port to bind HTTP server to [default: 1080]
+  -d --dir PATH                   Directory to store uploads in [default: ./data]
+  --base-path PATH             Basepath of the HTTP server [default: /files/]
+  --unix-sock PATH                If set will listen to a UNIX socket at this location instead of a TCP socket
+  --max-size SIZE                 Maximum size of a single upload in bytes [default: 0]
+  --store-size BYTE               Size of space allowed for storage [default: 0]
+  --timeout TIMEOUT               Read timeout for connections in milliseconds.  A zero value means that reads will not timeout [default: 30*1000]
+  --behind-proxy                  Respect X-Forwarded-* and similar headers which may be set by proxies [default: false]
+  --store KIND                    Storage backend to use, "file" or "s5" [default: file]
+  --s5-portal URL                 URL of the S5 portal to store uploads on, required when --store=s5
+  --s5-auth-token TOKEN           Auth token to present to the S5 portal
+  --s5-object-prefix PREFIX       Prefix prepended to every object key written to the S5 portal
+  --s5-timeout MS                  Milliseconds to allow a single request to the S5 portal to run before it's aborted [default: 10000]
+  --expose-metrics                Expose a Prometheus metrics endpoint [default: false]
+  --metrics-path PATH              Path to expose the metrics endpoint at [default: /metrics]
+  --hooks-dir PATH                 Directory containing pre-create/post-receive/post-finish/post-terminate scripts
+  --hooks-http URL                 URL to POST hook payloads to, instead of running scripts
+  --hooks-http-retry N             Number of times to retry a failed HTTP hook [default: 0]
+  --hooks-http-backoff MS          Milliseconds to wait between HTTP hook retries [default: 1000]
+  --hooks-timeout MS               Milliseconds to allow a hook script or HTTP hook request to run before it's aborted [default: 10000]
+  --locker KIND                    Upload locker backend to use, "memory" or "redis" [default: memory]
+  --redis-addr ADDR                Address of the Redis instance to use for --locker=redis
+  --redis-lease-ms MS              Milliseconds a Redis lock is leased for before it needs renewal [default: 10000]
+  --shutdown-timeout MS            Milliseconds to wait for in-flight uploads to finish on SIGINT/SIGTERM before forcing shutdown [default: 10000]
+`
+
+type ServerConf struct {
+  httpHost        string
+  httpPort        string
+  httpSock        string
+  maxSize         int64
+  uploadDir       string
+  storeSize       int64
+  listingEndpoint string
+  uploadEndpoint  string
+  timeout         int64
+  isBehindProxy   bool
+  store           string
+  s5PortalURL     string
+  s5AuthToken     string
+  s5ObjectPrefix  string
+  s5Timeout       int64
+  exposeMetrics    bool
+  metricsPath      string
+  hooksDir         string
+  hooksHTTPURL     string
+  hooksHTTPRetry   int64
+  hooksHTTPBackoff int64
+  hooksTimeout     int64
+  locker           string
+  redisAddr        string
+  redisLeaseMs     int64
+  shutdownTimeout  int64
+}
+
+var stdout = log.New(os.Stdout, "[tusd] ", log.Ldate|log.Ltime)
+var stderr = log.New(os.Stderr, "[tusd] ", log.Ldate|log.Ltime)
+
+func logEv(logOutput *log.Logger, eventName string, details ...string) {
+  tusd.LogEvent(logOutput, eventName, details...)
+}
+
+func Server() {
+  var conf ServerConf
+  arguments, _ := docopt.ParseDoc(serverUsage)
+  conf.httpHost, _ = arguments.String("--host")
+  conf.httpPort, _ = arguments.String("--port")
+  conf.httpSock, _ = arguments.String("--unix-sock")
+  conf.maxSize = util.GetInt64(arguments, "--max-size")
+  conf.uploadDir, _ = arguments.String("--dir")
+  conf.storeSize = util.GetInt64(arguments, "--store-size")
+  conf.listingEndpoint = "/"
+  conf.uploadEndpoint, _ = arguments.String("--base-path")
+  conf.timeout = util.GetInt64(arguments, "--timeout")
+  conf.isBehindProxy, _ = arguments.Bool("--behind-proxy")
+  conf.store, _ = arguments.String("--store")
+  conf.s5PortalURL, _ = arguments.String("--s5-portal")
+  conf.s5AuthToken, _ = arguments.String("--s5-auth-token")
+  conf.s5ObjectPrefix, _ = arguments.String("--s5-object-prefix")
+  conf.s5Timeout = util.GetInt64(arguments, "--s5-timeout")
+  conf.exposeMetrics, _ = arguments.Bool("--expose-metrics")
+  conf.metricsPath, _ = arguments.String("--metrics-path")
+  conf.hooksDir, _ = arguments.String("--hooks-dir")
+  conf.hooksHTTPURL, _ = arguments.String("--hooks-http")
+  conf.hooksHTTPRetry = util.GetInt64(arguments, "--hooks-http-retry")
+  conf.hooksHTTPBackoff = util.GetInt64(arguments, "--hooks-http-backoff")
+  conf.hooksTimeout = util.GetInt64(arguments, "--hooks-timeout")
+  conf.locker, _ = arguments.String("--locker")
+  conf.redisAddr, _ = arguments.String("--redis-addr")
+  conf.redisLeaseMs = util.GetInt64(arguments, "--redis-lease-ms")
+  conf.shutdownTimeout = util.GetInt64(arguments, "--shutdown-timeout")
+
+  storeComposer, lister, err := buildComposer(conf)
+  if err != nil {
+    stderr.Fatalf("Unable to set up %s store: %s", conf.store, err)
+  }
+
+  lock, err := buildLocker(conf)
+  if err != nil {
+    stderr.Fatalf("Unable to set up %s locker: %s", conf.locker, err)
+  }
+  lock.UseIn(storeComposer)
+
+  if conf.store == storeKindFile && conf.storeSize > 0 {
+    // We need to ensure that a single upload can fit into the storage size
+    if conf.maxSize > conf.storeSize || conf.maxSize == 0 {
+      conf.maxSize = conf.storeSize
+    }
+  }
+
+  stdout.Printf("Using %.2fMB as maximum size.\n", float64(conf.maxSize)/1024/1024)
+
+  // Serve
+
+  // Address
+  address := ""
+  // listingBaseURL is where the listing page's links point. Over a unix
+  // socket there's no host:port to build an absolute URL from, so links are
+  // left path-relative to the page itself.
+  listingBaseURL := ""
+  if conf.httpSock != "" {
+    address = conf.httpSock
+    listingBaseURL = conf.uploadEndpoint
+    stdout.Printf("Using %s as socket to listen.\n", address)
+  } else {
+    address = conf.httpHost + ":" + conf.httpPort
+    listingBaseURL = "http://" + address + conf.uploadEndpoint
+    stdout.Printf("Using %s as address to listen.\n", address)
+  }
+
+  // Base path
+  stdout.Printf("Using %s as the base path.\n", conf.uploadEndpoint)
+
+  // show capabilities
+  stdout.Printf(storeComposer.Capabilities())
+
+  var m *metrics.Metrics
+  if conf.exposeMetrics {
+    m = metrics.New()
+  }
+
+  var hookHandler hooks.Handler
+  switch {
+  case conf.hooksHTTPURL != "":
+    stdout.Printf("Using %s as the HTTP hooks endpoint.\n", conf.hooksHTTPURL)
+    hookHandler = hooks.NewHTTPHandler(conf.hooksHTTPURL, int(conf.hooksHTTPRetry), time.Duration(conf.hooksHTTPBackoff)*time.Millisecond, time.Duration(conf.hooksTimeout)*time.Millisecond)
+  case conf.hooksDir != "":
+    stdout.Printf("Using %s as the hooks directory.\n", conf.hooksDir)
+    hookHandler = hooks.NewFileHandler(conf.hooksDir, time.Duration(conf.hooksTimeout)*time.Millisecond)
+  }
+
+  notify := conf.exposeMetrics || hookHandler != nil
+
+  // tus handler
+  handler, err := tusd.NewHandler(tusd.Config{
+    MaxSize:                 conf.maxSize,
+    BasePath:                conf.uploadEndpoint,
+    RespectForwardedHeaders: conf.isBehindProxy,
+    StoreComposer:           storeComposer,
+    NotifyCompleteUploads:   notify,
+    NotifyTerminatedUploads: notify,
+    NotifyUploadProgress:    notify,
+    NotifyCreatedUploads:    conf.exposeMetrics,
+  })
+  if err != nil {
+    stderr.Fatalf("Unable to create handler: %s", err)
+  }
+
+  drain := &draining{}
+  http.Handle(conf.uploadEndpoint, http.StripPrefix(conf.uploadEndpoint, drain.wrap(preCreateInterceptor(handler, hookHandler, conf.isBehindProxy))))
+  if conf.listingEndpoint != conf.uploadEndpoint {
+    http.Handle(conf.listingEndpoint, http.StripPrefix(conf.listingEndpoint, homepage(lister, listingBaseURL)))
+  }
+
+  if notify {
+    go watchEvents(handler, m, hookHandler)
+  }
+  if conf.exposeMetrics {
+    http.Handle(conf.metricsPath, m.Handler())
+    stdout.Printf("Exposing metrics at %s.\n", conf.metricsPath)
+  }
+
+  var listener net.Listener
+  timeoutDuration := time.Duration(conf.timeout) * time.Millisecond
+
+  if conf.httpSock != "" {
+    if listener, err = util.NewUnixListener(address, timeoutDuration, timeoutDuration); err != nil {
+      stderr.Fatalf("Unable to create listener: %s", err)
+    }
+    stdout.Printf("You can now upload files to: http://%s%s", address, conf.uploadEndpoint)
+  } else {
+    if listener, err = util.NewListener(address, timeoutDuration, timeoutDuration); err != nil {
+      stderr.Fatalf("Unable to create listener: %s", err)
+    }
+  }
+
+  if conf.exposeMetrics {
+    listener = m.WrapListener(listener)
+  }
+
+  srv := &http.Server{}
+  serveErr := make(chan error, 1)
+  go func() {
+    serveErr <- srv.Serve(listener)
+  }()
+
+  sigs := make(chan os.Signal, 1)
+  signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+  select {
+  case err = <-serveErr:
+    if err != nil && err != http.ErrServerClosed {
+      stderr.Fatalf("Unable to serve: %s", err)
+    }
+  case sig := <-sigs:
+    stdout.Printf("Received %s, draining in-flight uploads (up to %dms).\n", sig, conf.shutdownTimeout)
+    shutdownTimeout := time.Duration(conf.shutdownTimeout) * time.Millisecond
+    shutdownStart := time.Now()
+
+    ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    if err = srv.Shutdown(ctx); err != nil {
+      stdout.Printf("Shutdown deadline exceeded, forcing close: %s\n", err)
+    }
+    cancel()
+
+    // srv.Shutdown already waited out its share of shutdownTimeout; only the
+    // remainder is left for drain to confirm the WaitGroup is empty too, so
+    // the two waits together never exceed the single budget the operator
+    // configured.
+    if remaining := shutdownTimeout - time.Since(shutdownStart); remaining > 0 {
+      if !drain.wait(remaining) {
+        stdout.Printf("Timed out waiting for in-flight uploads to finish.\n")
+      }
+    }
+
+    lock.Shutdown()
+    stdout.Printf("Shutdown complete.\n")
+  }
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+  "net/http"
+  "sync"
+  "time"
+)
+
+// draining tracks in-flight requests against the tus handler with a
+// sync.WaitGroup, so Server() can wait for uploads that are already underway
+// to finish (and flush their final .info state) before the process exits.
+type draining struct {
+  wg sync.WaitGroup
+}
+
+// wrap returns h instrumented to register itself with d for the duration of
+// each request.
+func (d *draining) wrap(h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    d.wg.Add(1)
+    defer d.wg.Done()
+    h.ServeHTTP(w, r)
+  })
+}
+
+// wait blocks until every request d is tracking has completed, or until
+// timeout elapses, whichever comes first. It reports whether draining
+// finished cleanly.
+func (d *draining) wait(timeout time.Duration) bool {
+  done := make(chan struct{})
+  go func() {
+    d.wg.Wait()
+    close(done)
+  }()
+
+  select {
+  case <-done:
+    return true
+  case <-time.After(timeout):
+    return false
+  }
+}